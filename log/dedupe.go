@@ -0,0 +1,227 @@
+package log
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// dedupeLRUSize bounds how many distinct records Deduper tracks at
+// once, so a flood of distinct lines during an outage can't grow its
+// memory use unbounded.
+const dedupeLRUSize = 1024
+
+// defaultDedupeWindow is used by Deduper in place of a zero or
+// negative window, e.g. from an uninitialized config field.
+const defaultDedupeWindow = 10 * time.Second
+
+// Deduper wraps inner so that identical structured records (same
+// level and keyvals, ignoring `ts`) logged again within window are
+// suppressed rather than passed through; once window has elapsed for
+// a record, either because a non-duplicate arrives or because the
+// background ticker flushes it, a single line carrying the original
+// keyvals plus a `repeated` count of how many were collapsed is
+// emitted through inner. A window <= 0 is replaced with
+// defaultDedupeWindow, since time.NewTicker panics on a non-positive
+// interval.
+//
+// Records are tracked in an LRU bounded at 1024 entries; evicting an
+// entry flushes it immediately. This is aimed at noisy loops like
+// NewInfluxdbMonitor's connectivity ping and Gorm's slow-query
+// warnings, which can otherwise flood logs during an outage.
+//
+// Callers must Close the returned DedupedLogger to stop its
+// background flush goroutine, e.g. when a request-scoped logger it
+// was built from goes out of scope.
+func Deduper(inner Logger, window time.Duration) *DedupedLogger {
+	if window <= 0 {
+		window = defaultDedupeWindow
+	}
+
+	d := &deduper{
+		inner:   inner,
+		window:  window,
+		entries: map[string]*dedupeEntry{},
+		lru:     list.New(),
+		done:    make(chan struct{}),
+	}
+
+	d.wg.Add(1)
+	go d.flushLoop()
+
+	return &DedupedLogger{Logger: Logger{Logger: d}, d: d}
+}
+
+// DedupedLogger is returned by Deduper. Close it to stop the
+// background goroutine that flushes stale entries.
+type DedupedLogger struct {
+	Logger
+	d *deduper
+}
+
+// Close stops the background flush goroutine, flushing any entries
+// still pending first. Safe to call more than once.
+func (dl *DedupedLogger) Close() error {
+	dl.d.closeOnce.Do(func() {
+		close(dl.d.done)
+	})
+	dl.d.wg.Wait()
+	return nil
+}
+
+type dedupeEntry struct {
+	key      string
+	keyvals  []interface{}
+	first    time.Time
+	repeated int
+	elem     *list.Element
+}
+
+type deduper struct {
+	inner  Logger
+	window time.Duration
+
+	mu      sync.Mutex
+	entries map[string]*dedupeEntry
+	lru     *list.List
+
+	done      chan struct{}
+	closeOnce sync.Once
+	wg        sync.WaitGroup
+}
+
+// Log part of go-kit's log.Logger.
+func (d *deduper) Log(keyvals ...interface{}) error {
+	key := dedupeKey(keyvals)
+	now := time.Now()
+
+	d.mu.Lock()
+	if e, ok := d.entries[key]; ok && now.Sub(e.first) < d.window {
+		e.repeated++
+		d.lru.MoveToFront(e.elem)
+		d.mu.Unlock()
+		return nil
+	}
+
+	stale, ok := d.entries[key]
+	if ok {
+		d.lru.Remove(stale.elem)
+		delete(d.entries, key)
+	}
+
+	e := &dedupeEntry{key: key, keyvals: keyvals, first: now}
+	e.elem = d.lru.PushFront(e)
+	d.entries[key] = e
+
+	var evicted *dedupeEntry
+	if d.lru.Len() > dedupeLRUSize {
+		back := d.lru.Back()
+		evicted = back.Value.(*dedupeEntry)
+		d.lru.Remove(back)
+		delete(d.entries, evicted.key)
+	}
+	d.mu.Unlock()
+
+	if stale != nil {
+		d.emitRepeated(stale)
+	}
+	if evicted != nil {
+		d.emitRepeated(evicted)
+	}
+
+	return d.inner.Log(keyvals...)
+}
+
+func (d *deduper) emitRepeated(e *dedupeEntry) {
+	if e.repeated == 0 {
+		return
+	}
+	keyvals := append(append([]interface{}{}, e.keyvals...), "repeated", e.repeated)
+	d.inner.Log(keyvals...)
+}
+
+func (d *deduper) flushLoop() {
+	defer d.wg.Done()
+
+	ticker := time.NewTicker(d.window)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			d.flushStale()
+		case <-d.done:
+			d.flushAll()
+			return
+		}
+	}
+}
+
+// flushAll emits every pending entry, regardless of whether its
+// window has elapsed, and clears the LRU. Used on Close so entries
+// still accumulating aren't silently dropped.
+func (d *deduper) flushAll() {
+	d.mu.Lock()
+	all := make([]*dedupeEntry, 0, len(d.entries))
+	for el := d.lru.Front(); el != nil; el = el.Next() {
+		all = append(all, el.Value.(*dedupeEntry))
+	}
+	d.lru.Init()
+	d.entries = map[string]*dedupeEntry{}
+	d.mu.Unlock()
+
+	for _, e := range all {
+		d.emitRepeated(e)
+	}
+}
+
+func (d *deduper) flushStale() {
+	now := time.Now()
+
+	d.mu.Lock()
+	var stale []*dedupeEntry
+	for el := d.lru.Front(); el != nil; {
+		next := el.Next()
+		e := el.Value.(*dedupeEntry)
+		if now.Sub(e.first) >= d.window {
+			d.lru.Remove(el)
+			delete(d.entries, e.key)
+			stale = append(stale, e)
+		}
+		el = next
+	}
+	d.mu.Unlock()
+
+	for _, e := range stale {
+		d.emitRepeated(e)
+	}
+}
+
+// dedupeKey hashes keyvals' pairs, sorted by key and excluding `ts`,
+// into a stable string so two records that only differ in timestamp
+// hash the same.
+func dedupeKey(keyvals []interface{}) string {
+	type pair struct {
+		k, v string
+	}
+
+	pairs := make([]pair, 0, len(keyvals)/2)
+	for i := 0; i+1 < len(keyvals); i += 2 {
+		k := fmt.Sprint(keyvals[i])
+		if k == "ts" {
+			continue
+		}
+		pairs = append(pairs, pair{k: k, v: fmt.Sprint(keyvals[i+1])})
+	}
+	sort.Slice(pairs, func(i, j int) bool { return pairs[i].k < pairs[j].k })
+
+	h := sha256.New()
+	for _, p := range pairs {
+		fmt.Fprintf(h, "%s=%s\x00", p.k, p.v)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -33,6 +33,21 @@ func (l Logger) With(keysvals ...interface{}) Logger {
 	return l
 }
 
+// componentKey is the structured log field Named tags loggers with.
+const componentKey = "component"
+
+// Named returns a copy of l with a "component" field set to name, so
+// every line it emits can be grepped by subsystem. An optional
+// instance suffix distinguishes multiple instances of the same
+// subsystem, e.g. Named("monitoring.influxdb", "metrics_db") yields
+// component=monitoring.influxdb:metrics_db.
+func (l Logger) Named(name string, instance ...string) Logger {
+	if len(instance) > 0 && instance[0] != "" {
+		name = name + ":" + instance[0]
+	}
+	return l.With(componentKey, name)
+}
+
 /*
 WrapError wrap an original error to kerrs and add to the structured log
 */
@@ -118,6 +133,16 @@ func LogWriter(logger log.Logger) io.Writer {
 	return &logWriter{logger}
 }
 
+// gormComponent is the component label GormLogger tags its lines with,
+// via Named.
+const gormComponent = "gorm"
+
+// NewGormLogger wraps logger for use as gorm's LogWriter, tagging every
+// line with component=gorm so it can be grepped out of structured logs.
+func NewGormLogger(logger Logger) GormLogger {
+	return GormLogger{Logger: logger.Named(gormComponent)}
+}
+
 type GormLogger struct {
 	Logger
 }
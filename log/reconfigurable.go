@@ -0,0 +1,171 @@
+package log
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"sync/atomic"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+)
+
+// Level is a log verbosity threshold, ordered from most to least
+// verbose.
+type Level int32
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+func (lv Level) String() string {
+	switch lv {
+	case LevelDebug:
+		return "debug"
+	case LevelInfo:
+		return "info"
+	case LevelWarn:
+		return "warn"
+	case LevelError:
+		return "error"
+	default:
+		return "unknown"
+	}
+}
+
+// ParseLevel parses the textual representation of a Level ("debug",
+// "info", "warn" or "error"). ok is false if s isn't one of those.
+func ParseLevel(s string) (lv Level, ok bool) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "debug":
+		return LevelDebug, true
+	case "info":
+		return LevelInfo, true
+	case "warn":
+		return LevelWarn, true
+	case "error":
+		return LevelError, true
+	default:
+		return 0, false
+	}
+}
+
+// logLevelEnvName is read once, by NewReconfigurableLogger, to set the
+// initial minimum level.
+const logLevelEnvName = "APPKIT_LOG_LEVEL"
+
+// ReconfigurableLogger wraps a Logger with a minimum log level that
+// can be changed at runtime, e.g. from LevelHandler. The level is
+// shared by every Logger derived from it via With, so changing it
+// once adjusts verbosity everywhere that logger (and its children)
+// are used.
+type ReconfigurableLogger struct {
+	Logger
+	level *int32
+}
+
+// NewReconfigurableLogger wraps logger with a mutable minimum level.
+// The initial level is debug, unless APPKIT_LOG_LEVEL names a valid
+// level, in which case that's used instead.
+func NewReconfigurableLogger(logger Logger) *ReconfigurableLogger {
+	lvl := LevelDebug
+	if parsed, ok := ParseLevel(os.Getenv(logLevelEnvName)); ok {
+		lvl = parsed
+	}
+
+	v := int32(lvl)
+	return &ReconfigurableLogger{Logger: logger, level: &v}
+}
+
+// Level returns the current minimum level.
+func (r *ReconfigurableLogger) Level() Level {
+	return Level(atomic.LoadInt32(r.level))
+}
+
+// SetLevel changes the minimum level. Safe to call concurrently with
+// logging.
+func (r *ReconfigurableLogger) SetLevel(lvl Level) {
+	atomic.StoreInt32(r.level, int32(lvl))
+}
+
+// With returns a derived ReconfigurableLogger that still shares this
+// logger's mutable level.
+func (r *ReconfigurableLogger) With(keyvals ...interface{}) *ReconfigurableLogger {
+	return &ReconfigurableLogger{Logger: r.Logger.With(keyvals...), level: r.level}
+}
+
+// Named returns a derived ReconfigurableLogger that still shares this
+// logger's mutable level. Without this override, calling Named on a
+// *ReconfigurableLogger would resolve to the embedded Logger's Named
+// and return a plain Logger that no longer consults r.level.
+func (r *ReconfigurableLogger) Named(name string, instance ...string) *ReconfigurableLogger {
+	return &ReconfigurableLogger{Logger: r.Logger.Named(name, instance...), level: r.level}
+}
+
+func (r *ReconfigurableLogger) allowed(lvl Level) log.Logger {
+	if lvl < r.Level() {
+		return log.NewNopLogger()
+	}
+	return r.Logger.Logger
+}
+
+func (r *ReconfigurableLogger) Debug() log.Logger {
+	return level.Debug(r.allowed(LevelDebug))
+}
+
+func (r *ReconfigurableLogger) Info() log.Logger {
+	return level.Info(r.allowed(LevelInfo))
+}
+
+func (r *ReconfigurableLogger) Warn() log.Logger {
+	return level.Warn(r.allowed(LevelWarn))
+}
+
+func (r *ReconfigurableLogger) Error() log.Logger {
+	return level.Error(r.allowed(LevelError))
+}
+
+func (r *ReconfigurableLogger) Crit() log.Logger {
+	return level.Error(r.allowed(LevelError))
+}
+
+// LevelHandler is an http.Handler that exposes a ReconfigurableLogger's
+// level for operators: GET returns the current level, PUT/POST with a
+// body of "debug", "info", "warn" or "error" changes it.
+type LevelHandler struct {
+	logger *ReconfigurableLogger
+}
+
+// NewLevelHandler returns a LevelHandler for logger.
+func NewLevelHandler(logger *ReconfigurableLogger) *LevelHandler {
+	return &LevelHandler{logger: logger}
+}
+
+func (h *LevelHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet:
+		fmt.Fprintln(w, h.logger.Level())
+	case http.MethodPut, http.MethodPost:
+		body, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		lvl, ok := ParseLevel(string(body))
+		if !ok {
+			http.Error(w, fmt.Sprintf("unknown log level %q", body), http.StatusBadRequest)
+			return
+		}
+
+		h.logger.SetLevel(lvl)
+		fmt.Fprintln(w, lvl)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
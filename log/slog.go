@@ -0,0 +1,130 @@
+package log
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+)
+
+// NewSlogLogger returns a Logger that routes records through h
+// instead of go-kit/log. It satisfies the same With/Info/Warn/
+// Error/Debug/Crit/WithError/WrapError API as a go-kit-backed Logger
+// (those methods are defined on Logger itself and only depend on the
+// embedded log.Logger's Log method), so a service can swap its logger
+// for one of these, and everything built on top keeps working while
+// the service migrates off go-kit/log incrementally.
+func NewSlogLogger(h slog.Handler) Logger {
+	return Logger{Logger: &slogLogger{handler: h}}
+}
+
+// slogLogger adapts an slog.Handler to go-kit's log.Logger interface.
+type slogLogger struct {
+	handler slog.Handler
+}
+
+// Log part of go-kit's log.Logger. keyvals is an alternating
+// key/value list, as produced by log.With and level.Debug/Info/Warn/
+// Error; each pair becomes an slog attr, except the `level` keyval
+// those helpers add, which is translated into the record's
+// slog.Level, and the conventional `msg` keyval, which becomes the
+// record's Message instead of a plain attr.
+func (s *slogLogger) Log(keyvals ...interface{}) error {
+	if len(keyvals)%2 != 0 {
+		keyvals = append(keyvals, "(MISSING)")
+	}
+
+	lvl := slog.LevelInfo
+	msg := ""
+
+	attrs := make([]slog.Attr, 0, len(keyvals)/2)
+	for i := 0; i+1 < len(keyvals); i += 2 {
+		k, v := keyvals[i], keyvals[i+1]
+		switch {
+		case k == level.Key():
+			lvl = slogLevelFor(v)
+		case k == "msg":
+			msg = fmt.Sprint(v)
+		default:
+			attrs = append(attrs, slog.Any(fmt.Sprint(k), v))
+		}
+	}
+
+	r := slog.NewRecord(time.Now(), lvl, msg, 0)
+	r.AddAttrs(attrs...)
+
+	return s.handler.Handle(context.Background(), r)
+}
+
+func slogLevelFor(levelValue interface{}) slog.Level {
+	switch fmt.Sprint(levelValue) {
+	case "debug":
+		return slog.LevelDebug
+	case "warn":
+		return slog.LevelWarn
+	case "error":
+		return slog.LevelError
+	default:
+		return slog.LevelInfo
+	}
+}
+
+// appkitHandler adapts a Logger to slog.Handler, so libraries that
+// only know how to log through log/slog can log through appkit.
+type appkitHandler struct {
+	logger Logger
+}
+
+// SlogHandler returns an slog.Handler that forwards records into
+// logger, translating slog's level and attrs into the keyvals Logger
+// expects.
+func SlogHandler(logger Logger) slog.Handler {
+	return &appkitHandler{logger: logger}
+}
+
+func (h *appkitHandler) Enabled(ctx context.Context, lvl slog.Level) bool {
+	return true
+}
+
+func (h *appkitHandler) Handle(ctx context.Context, r slog.Record) error {
+	keyvals := make([]interface{}, 0, r.NumAttrs()*2+2)
+	if r.Message != "" {
+		keyvals = append(keyvals, "msg", r.Message)
+	}
+	r.Attrs(func(a slog.Attr) bool {
+		keyvals = append(keyvals, a.Key, a.Value.Any())
+		return true
+	})
+
+	return h.leveled(r.Level).Log(keyvals...)
+}
+
+func (h *appkitHandler) leveled(lvl slog.Level) log.Logger {
+	switch {
+	case lvl < slog.LevelInfo:
+		return h.logger.Debug()
+	case lvl < slog.LevelWarn:
+		return h.logger.Info()
+	case lvl < slog.LevelError:
+		return h.logger.Warn()
+	default:
+		return h.logger.Error()
+	}
+}
+
+func (h *appkitHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	keyvals := make([]interface{}, 0, len(attrs)*2)
+	for _, a := range attrs {
+		keyvals = append(keyvals, a.Key, a.Value.Any())
+	}
+	return &appkitHandler{logger: h.logger.With(keyvals...)}
+}
+
+func (h *appkitHandler) WithGroup(name string) slog.Handler {
+	// Logger has no notion of groups; fall back to a flat field so
+	// attrs added under the group aren't silently dropped.
+	return &appkitHandler{logger: h.logger.With("group", name)}
+}
@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"net/url"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	influxdb "github.com/influxdata/influxdb/client"
@@ -11,25 +13,113 @@ import (
 	"github.com/theplant/appkit/log"
 )
 
-// InfluxMonitorConfig type for configuration of Monitor that sinks to
-// InfluxDB
-type InfluxMonitorConfig string
+// influxdbComponent is the component label NewInfluxdbMonitor tags its
+// logger with, via log.Named.
+const influxdbComponent = "monitoring.influxdb"
 
-// NewInfluxdbMonitor creates new monitoring influxdb
-// client. config URL syntax is `https://<username>:<password>@<influxDB host>/<database>`
+// droppedPointsMeasurement is the measurement InfluxdbMonitor reports
+// its own drop-oldest count under, so it's visible alongside the
+// metrics it's dropping.
+const droppedPointsMeasurement = "monitoring_dropped_points_total"
+
+const (
+	// DefaultMaxBatchSize is the number of points InfluxdbMonitor
+	// batches before triggering an immediate flush.
+	DefaultMaxBatchSize = 5000
+
+	// DefaultFlushInterval is how often InfluxdbMonitor flushes its
+	// batch even if MaxBatchSize hasn't been reached.
+	DefaultFlushInterval = 10 * time.Second
+
+	// DefaultMaxRetries is how many times InfluxdbMonitor retries a
+	// failed flush, with exponential backoff, before giving up on it.
+	DefaultMaxRetries = 3
+
+	// DefaultBufferSize bounds how many unflushed points InfluxdbMonitor
+	// keeps in memory. Once full, it drops the oldest point to make
+	// room for the newest.
+	DefaultBufferSize = 20000
+
+	initialRetryBackoff = 500 * time.Millisecond
+)
+
+// InfluxMonitorConfig configures an InfluxdbMonitor.
+type InfluxMonitorConfig struct {
+	// URL syntax is `https://<username>:<password>@<influxDB host>/<database>`
+	URL string
+
+	// MaxBatchSize is the number of points batched before an
+	// immediate flush is triggered. Zero means DefaultMaxBatchSize.
+	MaxBatchSize int
+
+	// FlushInterval is how often the batch is flushed even if
+	// MaxBatchSize hasn't been reached. Zero means
+	// DefaultFlushInterval.
+	FlushInterval time.Duration
+
+	// MaxRetries is how many times a failed flush is retried, with
+	// exponential backoff, before being dropped. Zero means
+	// DefaultMaxRetries.
+	MaxRetries int
+
+	// BufferSize bounds how many unflushed points are kept in memory.
+	// Zero means DefaultBufferSize.
+	BufferSize int
+}
+
+// Parse builds an InfluxMonitorConfig from a bare InfluxDB URL, using
+// the default batching/retry settings. It exists so callers upgrading
+// from the old `InfluxMonitorConfig(url)` conversion keep working.
+func Parse(monitorURL string) InfluxMonitorConfig {
+	return InfluxMonitorConfig{URL: monitorURL}
+}
+
+func (c InfluxMonitorConfig) withDefaults() InfluxMonitorConfig {
+	if c.MaxBatchSize <= 0 {
+		c.MaxBatchSize = DefaultMaxBatchSize
+	}
+	if c.FlushInterval <= 0 {
+		c.FlushInterval = DefaultFlushInterval
+	}
+	if c.MaxRetries <= 0 {
+		c.MaxRetries = DefaultMaxRetries
+	}
+	if c.BufferSize <= 0 {
+		c.BufferSize = DefaultBufferSize
+	}
+	return c
+}
+
+// NewInfluxdbMonitor creates a new monitor that batches points in
+// memory and flushes them to InfluxDB in the background, either every
+// config.FlushInterval or as soon as config.MaxBatchSize points have
+// accumulated, whichever comes first. A failed flush is retried with
+// exponential backoff up to config.MaxRetries times; once the
+// in-memory buffer reaches config.BufferSize, the oldest buffered
+// point is dropped to make room and a droppedPointsMeasurement point
+// is reported on the next periodic (config.FlushInterval) flush or on
+// Close; flushes triggered by config.MaxBatchSize don't report it.
+//
+// An optional instance name distinguishes the logs of multiple
+// InfluxDB monitors in the same process, e.g.
+// NewInfluxdbMonitor(config, logger, "metrics_db") tags every line
+// component=monitoring.influxdb:metrics_db.
 //
-// Will returns a error if monitorURL is invalid or not absolute.
+// Will return an error if config.URL is invalid or not absolute.
 //
 // Will not return error if InfluxDB is unavailable, but the returned
-// Monitor will log errors if it cannot push metrics into InfluxDB
-func NewInfluxdbMonitor(config InfluxMonitorConfig, logger log.Logger) (Monitor, error) {
-	monitorURL := string(config)
+// Monitor will log errors if it cannot push metrics into InfluxDB.
+//
+// Callers must Close the returned monitor to flush buffered points
+// and stop its background goroutine, e.g. on shutdown.
+func NewInfluxdbMonitor(config InfluxMonitorConfig, logger log.Logger, instance ...string) (*InfluxdbMonitor, error) {
+	config = config.withDefaults()
 
-	u, err := url.Parse(monitorURL)
+	u, err := url.Parse(config.URL)
 	if err != nil {
-		return nil, errors.Wrapf(err, "couldn't parse influxdb url %v", monitorURL)
+		return nil, errors.Wrapf(err, "couldn't parse influxdb url %v", config.URL)
 	} else if !u.IsAbs() {
-		return nil, errors.Errorf("influxdb monitoring url %v not absolute url", monitorURL)
+		return nil, errors.Errorf("influxdb monitoring url %v not absolute url", config.URL)
 	}
 
 	// NewClient always returns a nil error
@@ -37,10 +127,18 @@ func NewInfluxdbMonitor(config InfluxMonitorConfig, logger log.Logger) (Monitor,
 		URL: *u,
 	})
 
-	monitor := influxdbMonitor{
-		database: strings.TrimLeft(u.Path, "/"),
-		client:   client,
-		logger:   logger,
+	logger = logger.Named(influxdbComponent, instance...)
+
+	monitor := &InfluxdbMonitor{
+		database:      strings.TrimLeft(u.Path, "/"),
+		client:        client,
+		logger:        logger,
+		maxBatchSize:  config.MaxBatchSize,
+		maxRetries:    config.MaxRetries,
+		bufferSize:    config.BufferSize,
+		flushInterval: config.FlushInterval,
+		flushNow:      make(chan struct{}, 1),
+		done:          make(chan struct{}),
 	}
 
 	logger = logger.With(
@@ -50,9 +148,16 @@ func NewInfluxdbMonitor(config InfluxMonitorConfig, logger log.Logger) (Monitor,
 		"host", u.Host,
 	)
 
+	monitor.wg.Add(1)
+	go monitor.flushLoop()
+
 	// check connectivity to InfluxDB every 5 minutes
+	monitor.wg.Add(1)
 	go func() {
-		t := time.NewTimer(5 * time.Minute)
+		defer monitor.wg.Done()
+
+		t := time.NewTicker(5 * time.Minute)
+		defer t.Stop()
 
 		for {
 			// Ignore duration, version
@@ -65,7 +170,11 @@ func NewInfluxdbMonitor(config InfluxMonitorConfig, logger log.Logger) (Monitor,
 				)
 			}
 
-			<-t.C
+			select {
+			case <-t.C:
+			case <-monitor.done:
+				return
+			}
 		}
 	}()
 
@@ -73,63 +182,167 @@ func NewInfluxdbMonitor(config InfluxMonitorConfig, logger log.Logger) (Monitor,
 		"msg", fmt.Sprintf("influxdb instrumentation writing to %s://%s@%s/%s", u.Scheme, u.User.Username(), u.Host, monitor.database),
 	)
 
-	return &monitor, nil
+	return monitor, nil
 }
 
-// InfluxdbMonitor implements monitor.Monitor interface, it wraps
-// the influxdb client configuration.
-type influxdbMonitor struct {
+// InfluxdbMonitor implements the Monitor interface. It wraps the
+// influxdb client configuration, batching points in memory and
+// flushing them on a background goroutine.
+type InfluxdbMonitor struct {
 	client   *influxdb.Client
 	database string
 	logger   log.Logger
+
+	maxBatchSize int
+	maxRetries   int
+	bufferSize   int
+
+	mu      sync.Mutex
+	buffer  []influxdb.Point
+	dropped uint64
+
+	flushInterval time.Duration
+	flushNow      chan struct{}
+	done          chan struct{}
+	closeOnce     sync.Once
+	wg            sync.WaitGroup
 }
 
-// InsertRecord part of monitor.Monitor.
-func (im influxdbMonitor) InsertRecord(measurement string, value interface{}, tags map[string]string, fields map[string]interface{}, at time.Time) {
+// DroppedPoints returns the number of points dropped so far because
+// the in-memory buffer was full.
+func (im *InfluxdbMonitor) DroppedPoints() uint64 {
+	return atomic.LoadUint64(&im.dropped)
+}
+
+// InsertRecord part of Monitor.
+func (im *InfluxdbMonitor) InsertRecord(measurement string, value interface{}, tags map[string]string, fields map[string]interface{}, at time.Time) {
 	if fields == nil {
 		fields = map[string]interface{}{}
 	}
 
 	fields["value"] = value
 
-	// Ignore response, we only care about write errors
-	_, err := im.client.Write(influxdb.BatchPoints{
-		Database: im.database,
-		Points: []influxdb.Point{
-			{
-				Measurement: measurement,
-				Fields:      fields,
-				Tags:        tags,
-				Time:        at,
-			},
-		},
+	im.enqueue(influxdb.Point{
+		Measurement: measurement,
+		Fields:      fields,
+		Tags:        tags,
+		Time:        at,
 	})
+}
 
-	if err != nil {
-		im.logger.Error().Log(
-			"err", err,
-			"database", im.database,
-			"measurement", measurement,
-			"value", value,
-			"tags", tags,
-			"during", "influxdb.Client.Write",
-			"msg", fmt.Sprintf("Error inserting record into %s: %v", measurement, err),
-		)
+func (im *InfluxdbMonitor) enqueue(point influxdb.Point) {
+	im.mu.Lock()
+	if len(im.buffer) >= im.bufferSize {
+		im.buffer = im.buffer[1:]
+		atomic.AddUint64(&im.dropped, 1)
+	}
+	im.buffer = append(im.buffer, point)
+	needFlush := len(im.buffer) >= im.maxBatchSize
+	im.mu.Unlock()
+
+	if needFlush {
+		select {
+		case im.flushNow <- struct{}{}:
+		default:
+		}
 	}
 }
 
-func (im influxdbMonitor) Count(measurement string, value float64, tags map[string]string, fields map[string]interface{}) {
+func (im *InfluxdbMonitor) Count(measurement string, value float64, tags map[string]string, fields map[string]interface{}) {
 	im.InsertRecord(measurement, value, tags, fields, time.Now())
 }
 
 // CountError logs a value in measurement, with the given error's
 // message stored in an `error` tag.
-func (im influxdbMonitor) CountError(measurement string, value float64, err error) {
+func (im *InfluxdbMonitor) CountError(measurement string, value float64, err error) {
 	data := map[string]string{"error": err.Error()}
 	im.Count(measurement, value, data, nil)
 }
 
 // CountSimple logs a value in measurement (with no tags).
-func (im influxdbMonitor) CountSimple(measurement string, value float64) {
+func (im *InfluxdbMonitor) CountSimple(measurement string, value float64) {
 	im.Count(measurement, value, nil, nil)
 }
+
+// Close flushes any buffered points and stops the background flusher.
+// It's safe to call more than once.
+func (im *InfluxdbMonitor) Close() error {
+	im.closeOnce.Do(func() {
+		close(im.done)
+		im.wg.Wait()
+	})
+	return nil
+}
+
+func (im *InfluxdbMonitor) flushLoop() {
+	defer im.wg.Done()
+
+	ticker := time.NewTicker(im.flushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			im.reportDropped()
+			im.flush()
+		case <-im.flushNow:
+			im.flush()
+		case <-im.done:
+			im.reportDropped()
+			im.flush()
+			return
+		}
+	}
+}
+
+// reportDropped queues a droppedPointsMeasurement point recording how
+// many points have been dropped so far, so operators can see it
+// alongside the metrics it caused to be lost.
+func (im *InfluxdbMonitor) reportDropped() {
+	if dropped := im.DroppedPoints(); dropped > 0 {
+		im.enqueue(influxdb.Point{
+			Measurement: droppedPointsMeasurement,
+			Fields:      map[string]interface{}{"value": float64(dropped)},
+			Time:        time.Now(),
+		})
+	}
+}
+
+func (im *InfluxdbMonitor) flush() {
+	im.mu.Lock()
+	points := im.buffer
+	im.buffer = nil
+	im.mu.Unlock()
+
+	if len(points) == 0 {
+		return
+	}
+
+	backoff := initialRetryBackoff
+	var err error
+	for attempt := 0; attempt <= im.maxRetries; attempt++ {
+		_, err = im.client.Write(influxdb.BatchPoints{
+			Database: im.database,
+			Points:   points,
+		})
+		if err == nil {
+			return
+		}
+
+		if attempt == im.maxRetries {
+			break
+		}
+
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+
+	im.logger.Error().Log(
+		"err", err,
+		"database", im.database,
+		"points", len(points),
+		"retries", im.maxRetries,
+		"during", "influxdb.Client.Write",
+		"msg", fmt.Sprintf("Error flushing %d points after %d retries: %v", len(points), im.maxRetries, err),
+	)
+}
@@ -0,0 +1,163 @@
+package monitoring
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/theplant/appkit/log"
+)
+
+func testLogger() log.Logger {
+	return log.NewNopLogger()
+}
+
+// countingServer counts writes to InfluxDB's /write endpoint and
+// counts how many lines (points) each one carries. The first
+// failUntil writes respond 500; everything after responds 204.
+type countingServer struct {
+	mu         sync.Mutex
+	writes     int
+	points     int
+	failUntil  int
+	httpServer *httptest.Server
+}
+
+func newCountingServer(failUntil int) *countingServer {
+	cs := &countingServer{failUntil: failUntil}
+	cs.httpServer = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// NewInfluxdbMonitor's connectivity-ping goroutine also hits
+		// this server (a GET to /ping), concurrently with the test's
+		// writes; only count actual writes so the ping can't be
+		// mistaken for one.
+		if r.URL.Path != "/write" {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		body := new(bytes.Buffer)
+		body.ReadFrom(r.Body)
+
+		cs.mu.Lock()
+		cs.writes++
+		n := cs.writes
+		if body.Len() > 0 {
+			cs.points += bytes.Count(bytes.TrimRight(body.Bytes(), "\n"), []byte("\n")) + 1
+		}
+		cs.mu.Unlock()
+
+		if n <= cs.failUntil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	return cs
+}
+
+func (cs *countingServer) Close() {
+	cs.httpServer.Close()
+}
+
+func (cs *countingServer) counts() (writes, points int) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	return cs.writes, cs.points
+}
+
+func newTestMonitor(t *testing.T, url string, config InfluxMonitorConfig) *InfluxdbMonitor {
+	t.Helper()
+
+	config.URL = url + "/db"
+	m, err := NewInfluxdbMonitor(config, testLogger())
+	if err != nil {
+		t.Fatalf("NewInfluxdbMonitor: %v", err)
+	}
+	return m
+}
+
+func TestInfluxdbMonitorBatchesByMaxBatchSize(t *testing.T) {
+	server := newCountingServer(0)
+	defer server.Close()
+
+	m := newTestMonitor(t, server.URL, InfluxMonitorConfig{
+		MaxBatchSize:  3,
+		FlushInterval: time.Hour,
+		MaxRetries:    1,
+		BufferSize:    100,
+	})
+	defer m.Close()
+
+	for i := 0; i < 3; i++ {
+		m.CountSimple("test_measurement", float64(i))
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		if writes, points := server.counts(); writes >= 1 {
+			if points != 3 {
+				t.Fatalf("expected 3 points in a single batch, got %d across %d writes", points, writes)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for batch flush")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestInfluxdbMonitorRetriesOnFailure(t *testing.T) {
+	server := newCountingServer(2)
+	defer server.Close()
+
+	m := newTestMonitor(t, server.URL, InfluxMonitorConfig{
+		MaxBatchSize:  100,
+		FlushInterval: time.Hour,
+		MaxRetries:    3,
+		BufferSize:    100,
+	})
+
+	m.CountSimple("test_measurement", 1)
+
+	// Close drains the buffer via a final flush, retrying inline.
+	if err := m.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	writes, _ := server.counts()
+	if writes != 3 {
+		t.Fatalf("expected 2 failed attempts + 1 success = 3 writes, got %d", writes)
+	}
+}
+
+func TestInfluxdbMonitorDropsOldestWhenBufferFull(t *testing.T) {
+	server := newCountingServer(0)
+	defer server.Close()
+
+	m := newTestMonitor(t, server.URL, InfluxMonitorConfig{
+		MaxBatchSize:  1000,
+		FlushInterval: time.Hour,
+		MaxRetries:    1,
+		BufferSize:    2,
+	})
+	defer m.Close()
+
+	for i := 0; i < 5; i++ {
+		m.CountSimple("test_measurement", float64(i))
+	}
+
+	if got, want := m.DroppedPoints(), uint64(3); got != want {
+		t.Fatalf("DroppedPoints() = %d, want %d", got, want)
+	}
+
+	m.mu.Lock()
+	buffered := len(m.buffer)
+	m.mu.Unlock()
+	if buffered != 2 {
+		t.Fatalf("buffered points = %d, want 2", buffered)
+	}
+}
@@ -0,0 +1,54 @@
+package monitoring
+
+import "time"
+
+// Monitor records metrics into some storage or exposition backend,
+// e.g. InfluxDB or Prometheus.
+type Monitor interface {
+	// InsertRecord logs value (and any tags/fields) under measurement,
+	// timestamped at.
+	InsertRecord(measurement string, value interface{}, tags map[string]string, fields map[string]interface{}, at time.Time)
+
+	// Count logs value under measurement, timestamped now.
+	Count(measurement string, value float64, tags map[string]string, fields map[string]interface{})
+
+	// CountError logs a value in measurement, with the given error's
+	// message stored in an `error` tag.
+	CountError(measurement string, value float64, err error)
+
+	// CountSimple logs a value in measurement (with no tags).
+	CountSimple(measurement string, value float64)
+}
+
+// MultiMonitor fans every call out to each of ms, e.g. so an
+// application can double-write to InfluxDB and Prometheus while
+// migrating from one to the other.
+func MultiMonitor(ms ...Monitor) Monitor {
+	return multiMonitor(ms)
+}
+
+type multiMonitor []Monitor
+
+func (ms multiMonitor) InsertRecord(measurement string, value interface{}, tags map[string]string, fields map[string]interface{}, at time.Time) {
+	for _, m := range ms {
+		m.InsertRecord(measurement, value, tags, fields, at)
+	}
+}
+
+func (ms multiMonitor) Count(measurement string, value float64, tags map[string]string, fields map[string]interface{}) {
+	for _, m := range ms {
+		m.Count(measurement, value, tags, fields)
+	}
+}
+
+func (ms multiMonitor) CountError(measurement string, value float64, err error) {
+	for _, m := range ms {
+		m.CountError(measurement, value, err)
+	}
+}
+
+func (ms multiMonitor) CountSimple(measurement string, value float64) {
+	for _, m := range ms {
+		m.CountSimple(measurement, value)
+	}
+}
@@ -0,0 +1,206 @@
+package monitoring
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// counterEntry pairs a CounterVec with the label keys it was
+// registered with, so later calls for the same measurement name
+// reuse it regardless of which tag keys they happen to pass.
+type counterEntry struct {
+	vec  *prometheus.CounterVec
+	keys []string
+}
+
+// histogramEntry is counterEntry's equivalent for HistogramVec.
+type histogramEntry struct {
+	vec  *prometheus.HistogramVec
+	keys []string
+}
+
+// PrometheusMonitor implements Monitor by registering a Counter or
+// Histogram vector on demand the first time a measurement name is
+// seen, so applications can expose metrics via a scrape endpoint
+// instead of (or alongside, via MultiMonitor) pushing to InfluxDB.
+//
+// A vector's label keys are fixed by whichever call creates it;
+// later calls for the same measurement name that pass a different
+// set of tags are reconciled to that fixed schema (missing keys
+// default to "", unrecognized keys are dropped) rather than minting a
+// second, incompatible vector, which would panic on registration.
+// This is deliberate: CountSimple/CountError/Count/InsertRecord with
+// differing tags on one measurement name is ordinary Monitor usage.
+type PrometheusMonitor struct {
+	registry *prometheus.Registry
+
+	mu         sync.Mutex
+	counters   map[string]counterEntry
+	histograms map[string]histogramEntry
+	buckets    map[string][]float64
+}
+
+// NewPrometheusMonitor returns a Monitor that registers its metrics
+// into registry.
+func NewPrometheusMonitor(registry *prometheus.Registry) *PrometheusMonitor {
+	return &PrometheusMonitor{
+		registry:   registry,
+		counters:   map[string]counterEntry{},
+		histograms: map[string]histogramEntry{},
+		buckets:    map[string][]float64{},
+	}
+}
+
+// HistogramBuckets overrides the bucket boundaries InsertRecord uses
+// for measurement's histogram. Must be called before the first record
+// for that measurement, since a HistogramVec's buckets are fixed at
+// registration.
+func (m *PrometheusMonitor) HistogramBuckets(measurement string, buckets []float64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.buckets[measurement] = buckets
+}
+
+// InsertRecord part of Monitor. value is recorded into measurement's
+// histogram if it's numeric; tags become the histogram's label
+// values. Non-numeric values are ignored, since Prometheus has no
+// concept of an arbitrary-value gauge record.
+func (m *PrometheusMonitor) InsertRecord(measurement string, value interface{}, tags map[string]string, fields map[string]interface{}, at time.Time) {
+	f, ok := toFloat(value)
+	if !ok {
+		return
+	}
+	e := m.histogramFor(measurement, tags)
+	e.vec.With(labelsFor(e.keys, tags)).Observe(f)
+}
+
+// Count part of Monitor: increments measurement's counter by value.
+func (m *PrometheusMonitor) Count(measurement string, value float64, tags map[string]string, fields map[string]interface{}) {
+	e := m.counterFor(measurement, tags)
+	e.vec.With(labelsFor(e.keys, tags)).Add(value)
+}
+
+// CountError logs a value in measurement, with the given error's
+// message stored in an `error` tag.
+func (m *PrometheusMonitor) CountError(measurement string, value float64, err error) {
+	m.Count(measurement, value, map[string]string{"error": err.Error()}, nil)
+}
+
+// CountSimple logs a value in measurement (with no tags).
+func (m *PrometheusMonitor) CountSimple(measurement string, value float64) {
+	m.Count(measurement, value, nil, nil)
+}
+
+func (m *PrometheusMonitor) counterFor(measurement string, tags map[string]string) counterEntry {
+	name := metricName(measurement)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	e, ok := m.counters[name]
+	if !ok {
+		keys := tagKeys(tags)
+		e = counterEntry{
+			vec: prometheus.NewCounterVec(prometheus.CounterOpts{
+				Name: name,
+				Help: fmt.Sprintf("appkit monitoring counter for %s", measurement),
+			}, keys),
+			keys: keys,
+		}
+		m.registry.MustRegister(e.vec)
+		m.counters[name] = e
+	}
+	return e
+}
+
+func (m *PrometheusMonitor) histogramFor(measurement string, tags map[string]string) histogramEntry {
+	name := metricName(measurement)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	e, ok := m.histograms[name]
+	if !ok {
+		buckets, ok := m.buckets[measurement]
+		if !ok {
+			buckets = prometheus.DefBuckets
+		}
+
+		keys := tagKeys(tags)
+		e = histogramEntry{
+			vec: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+				Name:    name,
+				Help:    fmt.Sprintf("appkit monitoring histogram for %s", measurement),
+				Buckets: buckets,
+			}, keys),
+			keys: keys,
+		}
+		m.registry.MustRegister(e.vec)
+		m.histograms[name] = e
+	}
+	return e
+}
+
+// metricName turns an InfluxDB-style measurement name into a
+// Prometheus metric name by replacing dots with underscores. Other
+// characters Prometheus doesn't allow in metric names are left as is.
+func metricName(measurement string) string {
+	return strings.Replace(measurement, ".", "_", -1)
+}
+
+func tagKeys(tags map[string]string) []string {
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// labelsFor builds the label set for a vector whose declared label
+// keys are keys, from the given record/count tags: keys missing from
+// tags default to "", and tags not in keys are dropped, so a vector's
+// schema never needs to change after it's registered.
+func labelsFor(keys []string, tags map[string]string) prometheus.Labels {
+	labels := make(prometheus.Labels, len(keys))
+	for _, k := range keys {
+		labels[k] = tags[k]
+	}
+	return labels
+}
+
+func toFloat(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case float32:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	case int32:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case int8:
+		return float64(v), true
+	case int16:
+		return float64(v), true
+	case uint:
+		return float64(v), true
+	case uint8:
+		return float64(v), true
+	case uint16:
+		return float64(v), true
+	case uint32:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	default:
+		return 0, false
+	}
+}